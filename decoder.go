@@ -0,0 +1,270 @@
+package apng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+)
+
+// fcTL holds the fields of a parsed fcTL chunk.
+type fcTL struct {
+	seqNum    uint32
+	width     uint32
+	height    uint32
+	xOffset   uint32
+	yOffset   uint32
+	delayNum  uint16
+	delayDen  uint16
+	disposeOp byte
+	blendOp   byte
+}
+
+func parseFcTL(b []byte) fcTL {
+	return fcTL{
+		seqNum:    binary.BigEndian.Uint32(b[0:4]),
+		width:     binary.BigEndian.Uint32(b[4:8]),
+		height:    binary.BigEndian.Uint32(b[8:12]),
+		xOffset:   binary.BigEndian.Uint32(b[12:16]),
+		yOffset:   binary.BigEndian.Uint32(b[16:20]),
+		delayNum:  binary.BigEndian.Uint16(b[20:22]),
+		delayDen:  binary.BigEndian.Uint16(b[22:24]),
+		disposeOp: b[24],
+		blendOp:   b[25],
+	}
+}
+
+// decFrame is one fcTL chunk and the IDAT/fdAT data chunks that follow it,
+// with the fdAT sequence number already stripped.
+type decFrame struct {
+	fctl  fcTL
+	parts [][]byte
+}
+
+// writeRawChunk writes a length-prefixed, CRC-terminated PNG chunk to w.
+func writeRawChunk(w io.Writer, b []byte, name string) error {
+	var hdr [8]byte
+	writeUint32(hdr[:4], uint32(len(b)))
+	copy(hdr[4:8], name)
+	if _, err := w.Write(hdr[:8]); err != nil {
+		return err
+	}
+	if len(b) > 0 {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:8])
+	crc.Write(b)
+	var foot [4]byte
+	writeUint32(foot[:4], crc.Sum32())
+	_, err := w.Write(foot[:4])
+	return err
+}
+
+// buildFrameIHDR builds an IHDR chunk body for a single frame, reusing the
+// bit depth, color type, compression, filter and interlace method of the
+// original animation's IHDR.
+func buildFrameIHDR(width, height uint32, rest [5]byte) []byte {
+	b := make([]byte, 13)
+	writeUint32(b[0:4], width)
+	writeUint32(b[4:8], height)
+	copy(b[8:13], rest[:])
+	return b
+}
+
+// delayToCentiseconds normalizes an fcTL delay_num/delay_den pair to
+// hundredths of a second. A zero denominator means 100 per the APNG spec.
+func delayToCentiseconds(num, den uint16) uint16 {
+	if den == 0 {
+		den = 100
+	}
+	return uint16((uint32(num) * 100) / uint32(den))
+}
+
+// offsetImage translates img so that its bounds start at (dx, dy), copying
+// pixels into a fresh image of the same kind. It's a no-op if img's bounds
+// already start there.
+func offsetImage(img image.Image, dx, dy int) image.Image {
+	if b := img.Bounds(); b.Min.X == dx && b.Min.Y == dy {
+		return img
+	}
+	switch src := img.(type) {
+	case *image.Paletted:
+		dst := image.NewPaletted(image.Rect(dx, dy, dx+src.Rect.Dx(), dy+src.Rect.Dy()), src.Palette)
+		draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
+		return dst
+	default:
+		dst := image.NewNRGBA(image.Rect(dx, dy, dx+img.Bounds().Dx(), dy+img.Bounds().Dy()))
+		draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Src)
+		return dst
+	}
+}
+
+// decodeFrame synthesizes a single-frame PNG byte stream for f (IHDR sized to
+// the frame, the global PLTE/tRNS, and the frame's concatenated IDAT/fdAT
+// data) and decodes it with image/png, then positions it at its fcTL offset.
+func decodeFrame(f *decFrame, ihdrRest [5]byte, plteData, trnsData []byte, havePLTE, haveTRNS bool) (image.Image, error) {
+	bb := &bytes.Buffer{}
+	bb.WriteString(pngHeader)
+	if err := writeRawChunk(bb, buildFrameIHDR(f.fctl.width, f.fctl.height, ihdrRest), "IHDR"); err != nil {
+		return nil, err
+	}
+	if havePLTE {
+		if err := writeRawChunk(bb, plteData, "PLTE"); err != nil {
+			return nil, err
+		}
+	}
+	if haveTRNS {
+		if err := writeRawChunk(bb, trnsData, "tRNS"); err != nil {
+			return nil, err
+		}
+	}
+	var idat []byte
+	for _, p := range f.parts {
+		idat = append(idat, p...)
+	}
+	if err := writeRawChunk(bb, idat, "IDAT"); err != nil {
+		return nil, err
+	}
+	if err := writeRawChunk(bb, nil, "IEND"); err != nil {
+		return nil, err
+	}
+
+	img, err := png.Decode(bb)
+	if err != nil {
+		return nil, err
+	}
+	return offsetImage(img, int(f.fctl.xOffset), int(f.fctl.yOffset)), nil
+}
+
+// Decode reads an APNG image from r and returns it as an *APNG, mirroring
+// image/png's Decode. It errors if the stream is not a PNG, or if it is a
+// PNG without an acTL chunk (i.e. not animated).
+func Decode(r io.Reader) (*APNG, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	bb := bytes.NewBuffer(data)
+
+	if bb.Len() < len(pngHeader) || string(bb.Next(len(pngHeader))) != pngHeader {
+		return nil, errors.New("apng: not a PNG file")
+	}
+
+	var (
+		tmpHeader          [8]byte
+		ihdrRest           [5]byte
+		width, height      uint32
+		havePLTE, haveTRNS bool
+		plteData, trnsData []byte
+		haveACTL           bool
+		numFrames          uint32
+		numPlays           uint32
+		frames             []*decFrame
+		current            *decFrame
+	)
+
+parseLoop:
+	for {
+		if bb.Len() < 8 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		copy(tmpHeader[:], bb.Next(8))
+		length := binary.BigEndian.Uint32(tmpHeader[:4])
+		name := string(tmpHeader[4:8])
+		if uint32(bb.Len()) < length+4 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		chunkData := bb.Next(int(length))
+		bb.Next(4) // Discard crc.
+
+		switch name {
+		case "IHDR":
+			if len(chunkData) < 13 {
+				return nil, errors.New("apng: malformed IHDR chunk")
+			}
+			width = binary.BigEndian.Uint32(chunkData[0:4])
+			height = binary.BigEndian.Uint32(chunkData[4:8])
+			copy(ihdrRest[:], chunkData[8:13])
+		case "PLTE":
+			havePLTE = true
+			plteData = chunkData
+		case "tRNS":
+			haveTRNS = true
+			trnsData = chunkData
+		case "acTL":
+			if len(chunkData) < 8 {
+				return nil, errors.New("apng: malformed acTL chunk")
+			}
+			haveACTL = true
+			numFrames = binary.BigEndian.Uint32(chunkData[0:4])
+			numPlays = binary.BigEndian.Uint32(chunkData[4:8])
+		case "fcTL":
+			if len(chunkData) < 26 {
+				return nil, errors.New("apng: malformed fcTL chunk")
+			}
+			frames = append(frames, &decFrame{fctl: parseFcTL(chunkData)})
+			current = frames[len(frames)-1]
+		case "IDAT":
+			// An IDAT seen before the first fcTL is the default image, which
+			// is not part of the animation unless its own fcTL precedes it.
+			if current != nil {
+				current.parts = append(current.parts, chunkData)
+			}
+		case "fdAT":
+			if current == nil {
+				return nil, errors.New("apng: fdAT chunk without preceding fcTL")
+			}
+			if len(chunkData) < 4 {
+				return nil, errors.New("apng: malformed fdAT chunk")
+			}
+			current.parts = append(current.parts, chunkData[4:])
+		case "IEND":
+			break parseLoop
+		}
+	}
+
+	if !haveACTL {
+		return nil, errors.New("apng: not an animated PNG (missing acTL)")
+	}
+	if len(frames) == 0 {
+		return nil, errors.New("apng: acTL present but no frames found")
+	}
+	if uint32(len(frames)) != numFrames {
+		return nil, errors.New("apng: frame count mismatch between acTL and fcTL chunks")
+	}
+
+	a := &APNG{
+		Images:    make([]image.Image, len(frames)),
+		Delays:    make([]uint16, len(frames)),
+		Disposals: make([]byte, len(frames)),
+		BlendOps:  make([]byte, len(frames)),
+		LoopCount: numPlays,
+	}
+
+	for i, f := range frames {
+		img, err := decodeFrame(f, ihdrRest, plteData, trnsData, havePLTE, haveTRNS)
+		if err != nil {
+			return nil, err
+		}
+		a.Images[i] = img
+		a.Delays[i] = delayToCentiseconds(f.fctl.delayNum, f.fctl.delayDen)
+		a.Disposals[i] = f.fctl.disposeOp
+		a.BlendOps[i] = f.fctl.blendOp
+	}
+	a.Config = image.Config{ColorModel: a.Images[0].ColorModel(), Width: int(width), Height: int(height)}
+
+	return a, nil
+}
+
+// DecodeConfig returns the color model and dimensions of an APNG image
+// without decoding the entire image, mirroring image/png.DecodeConfig.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	return png.DecodeConfig(r)
+}
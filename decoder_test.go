@@ -0,0 +1,135 @@
+package apng
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestDecodeTruncatedChunks reproduces the review's repro: a crafted or
+// truncated APNG whose IHDR, acTL or fcTL chunk is shorter than its fixed
+// fields used to make Decode panic (e.g. "index out of range [24] with
+// length 0") instead of returning an error. Decode is a new entry point for
+// arbitrary input, so each case must fail cleanly.
+func TestDecodeTruncatedChunks(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []struct {
+			name string
+			data []byte
+		}
+	}{
+		{
+			name: "short IHDR",
+			chunks: []struct {
+				name string
+				data []byte
+			}{{"IHDR", make([]byte, 4)}},
+		},
+		{
+			name: "short acTL",
+			chunks: []struct {
+				name string
+				data []byte
+			}{
+				{"IHDR", make([]byte, 13)},
+				{"acTL", make([]byte, 4)},
+			},
+		},
+		{
+			name: "short fcTL",
+			chunks: []struct {
+				name string
+				data []byte
+			}{
+				{"IHDR", make([]byte, 13)},
+				{"acTL", make([]byte, 8)},
+				{"fcTL", make([]byte, 10)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			buf.WriteString(pngHeader)
+			for _, c := range tt.chunks {
+				if err := writeRawChunk(&buf, c.data, c.name); err != nil {
+					t.Fatalf("writeRawChunk(%s): %v", c.name, err)
+				}
+			}
+			if err := writeRawChunk(&buf, nil, "IEND"); err != nil {
+				t.Fatalf("writeRawChunk(IEND): %v", err)
+			}
+
+			if _, err := Decode(&buf); err == nil {
+				t.Fatal("Decode: got nil error, want an error on truncated chunk")
+			}
+		})
+	}
+}
+
+// TestDecodeEncodeRoundTrip covers the exact shape of animation the review
+// flagged: plain RGBA frames, no SubImage, no Optimize, where only one frame
+// out of several has partial transparency. Decode used to fail on this with
+// "png: invalid format: too much pixel data" because Encode let image/png
+// pick a different color type for the opaque frames than for the
+// translucent one.
+func TestDecodeEncodeRoundTrip(t *testing.T) {
+	size := image.Rect(0, 0, 4, 4)
+
+	opaqueA := image.NewRGBA(size)
+	opaqueB := image.NewRGBA(size)
+	translucent := image.NewRGBA(size)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			opaqueA.SetRGBA(x, y, color.RGBA{R: uint8(x * 20), G: uint8(y * 20), B: 100, A: 255})
+			opaqueB.SetRGBA(x, y, color.RGBA{R: 200, G: 10, B: 30, A: 255})
+			translucent.SetRGBA(x, y, color.RGBA{R: 50, G: 50, B: 50, A: 128})
+		}
+	}
+
+	a := &APNG{
+		Images:    []image.Image{opaqueA, translucent, opaqueB},
+		Delays:    []uint16{10, 20, 30},
+		LoopCount: 0,
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeAll(&buf, a); err != nil {
+		t.Fatalf("EncodeAll: %v", err)
+	}
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(got.Images) != 3 {
+		t.Fatalf("got %d frames, want 3", len(got.Images))
+	}
+	if got.Delays[0] != 10 || got.Delays[1] != 20 || got.Delays[2] != 30 {
+		t.Fatalf("got delays %v, want [10 20 30]", got.Delays)
+	}
+
+	// The fully opaque frames should round-trip exactly, except possibly at
+	// (0,0): unifyFrameFormat nudges one pixel's alpha on opaque frames by a
+	// single unit to keep their color type consistent with the translucent
+	// frame.
+	for _, i := range []int{0, 2} {
+		want := a.Images[i]
+		b := want.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if x == b.Min.X && y == b.Min.Y {
+					continue
+				}
+				wr, wg, wb, wa := want.At(x, y).RGBA()
+				gr, gg, gb, ga := got.Images[i].At(x, y).RGBA()
+				if wr != gr || wg != gg || wb != gb || wa != ga {
+					t.Fatalf("frame %d pixel (%d,%d): got %v want %v", i, x, y, got.Images[i].At(x, y), want.At(x, y))
+				}
+			}
+		}
+	}
+}
@@ -9,8 +9,6 @@ import (
 
 // Save writes an APNG file with the given images and uniform frame delay.
 //
-// Images obtained via image.SubImage() are not supported, If an image is a sub-image, copy it into a new image before encoding.
-//
 // The successive delay times, one per frame, in 100ths of a second (centiseconds).
 func Save(filePath string, images []image.Image, delay uint16) {
 	totalFrames := len(images)
@@ -42,8 +40,6 @@ func Save(filePath string, images []image.Image, delay uint16) {
 
 // APNGBytes encodes a slice of images into an APNG byte stream with a consistent delay per frame.
 //
-// Images obtained via image.SubImage() are not supported, If an image is a sub-image, copy it into a new image before encoding.
-//
 // The successive delay times, one per frame, in 100ths of a second (centiseconds).
 func APNGBytes(images []image.Image, delay uint16) []byte {
 	totalFrames := len(images)
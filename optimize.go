@@ -0,0 +1,153 @@
+package apng
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Optimize rewrites a's frames after the first in place, replacing each with
+// the smallest bounding-rectangle crop of the pixels that changed since the
+// previously-rendered canvas. Unchanged pixels inside that crop are made
+// transparent and BlendOps is set to BlendOpOver so the decoder leaves them
+// untouched, unless the frame itself needs a pixel to become fully
+// transparent, which would otherwise be indistinguishable from "leave this
+// pixel alone" under BlendOpOver: in that case BlendOps falls back to
+// BlendOpSource for the whole frame instead, so the crop is applied
+// literally. Disposals is set to DisposeOpNone so the canvas simply
+// accumulates each frame. This typically shrinks IDAT/fdAT payloads by
+// 2-10x for animations with mostly-static content, without changing how the
+// animation renders.
+//
+// Frames are never modified via SubImage; each cropped frame is a fresh
+// image, matching APNG.Images' existing constraint.
+//
+// Introducing transparency into frames after the first, while frame 0 stays
+// however it was, means the animation's frames no longer share a single
+// natural PNG color type: Encoder.Encode accounts for this by forcing every
+// frame through one consistent representation before encoding, so the
+// frames Optimize produces here don't need to pre-arrange that themselves.
+func Optimize(a *APNG) error {
+	if len(a.Images) == 0 {
+		return errors.New("apng: need at least one image")
+	}
+	if a.Disposals == nil {
+		a.Disposals = make([]byte, len(a.Images))
+	}
+	if a.BlendOps == nil {
+		a.BlendOps = make([]byte, len(a.Images))
+	}
+	if len(a.Disposals) != len(a.Images) {
+		return errors.New("apng: mismatch image and disposal lengths")
+	}
+	if len(a.BlendOps) != len(a.Images) {
+		return errors.New("apng: mismatch image and blend op lengths")
+	}
+
+	canvasBounds := a.Images[0].Bounds()
+	canvas := image.NewRGBA(canvasBounds)
+	draw.Draw(canvas, canvasBounds, a.Images[0], canvasBounds.Min, draw.Src)
+
+	for i := 1; i < len(a.Images); i++ {
+		frame := a.Images[i]
+		frameBounds := frame.Bounds()
+
+		// Render this frame over the running canvas, mirroring what a
+		// decoder would show, so the diff reflects what's actually on
+		// screen rather than just the raw frame pixels. a.Images isn't
+		// optimized yet, so it still renders with the library's default
+		// BlendOpSource (a full replace, not alpha compositing): using
+		// draw.Over here would blend a frame that intentionally lowers
+		// alpha (fading out, punching a transparent hole) against the
+		// still-opaque canvas, reproducing the old opaque pixel and making
+		// diffRect miss the edit entirely. draw.Src matches what actually
+		// renders.
+		next := image.NewRGBA(canvasBounds)
+		draw.Draw(next, canvasBounds, canvas, canvasBounds.Min, draw.Src)
+		draw.Draw(next, frameBounds, frame, frameBounds.Min, draw.Src)
+
+		rect, changed := diffRect(canvas, next)
+		if !changed {
+			// Identical to the previous canvas: keep a minimal 1x1 frame.
+			rect = image.Rect(frameBounds.Min.X, frameBounds.Min.Y, frameBounds.Min.X+1, frameBounds.Min.Y+1)
+		}
+
+		// Under Porter-Duff Over, a source pixel only reproduces itself
+		// exactly atop an arbitrary destination when it's fully opaque (the
+		// destination contributes nothing) or the destination is already
+		// fully transparent (it contributes nothing either way). Any other
+		// changed pixel — partial alpha atop a non-transparent canvas pixel,
+		// including the fully-transparent target that collides with the
+		// "leave this pixel alone" sentinel — can't be represented under
+		// BlendOpOver, so fall back to BlendOpSource for the whole frame,
+		// which always writes every pixel in the crop literally.
+		blendOp := byte(BlendOpOver)
+		for y := rect.Min.Y; y < rect.Max.Y && blendOp == BlendOpOver; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				nc := next.RGBAAt(x, y)
+				oc := canvas.RGBAAt(x, y)
+				if nc != oc && nc.A != 255 && oc != (color.RGBA{}) {
+					blendOp = BlendOpSource
+					break
+				}
+			}
+		}
+
+		cropped := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				nc := next.RGBAAt(x, y)
+				if blendOp == BlendOpOver && nc == canvas.RGBAAt(x, y) {
+					// Unchanged pixel inside the diff rect: make it
+					// transparent so BlendOpOver leaves the canvas alone.
+					cropped.SetRGBA(x-rect.Min.X, y-rect.Min.Y, color.RGBA{})
+					continue
+				}
+				cropped.SetRGBA(x-rect.Min.X, y-rect.Min.Y, nc)
+			}
+		}
+
+		a.Images[i] = offsetImage(cropped, rect.Min.X, rect.Min.Y)
+		a.Disposals[i] = DisposeOpNone
+		a.BlendOps[i] = blendOp
+
+		canvas = next
+	}
+
+	return nil
+}
+
+// diffRect returns the smallest rectangle containing every pixel where a and
+// b differ, and whether any pixel differed at all.
+func diffRect(a, b *image.RGBA) (rect image.Rectangle, changed bool) {
+	bounds := a.Bounds()
+	minX, minY := bounds.Max.X, bounds.Max.Y
+	maxX, maxY := bounds.Min.X, bounds.Min.Y
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if a.RGBAAt(x, y) == b.RGBAAt(x, y) {
+				continue
+			}
+			changed = true
+			if x < minX {
+				minX = x
+			}
+			if y < minY {
+				minY = y
+			}
+			if x+1 > maxX {
+				maxX = x + 1
+			}
+			if y+1 > maxY {
+				maxY = y + 1
+			}
+		}
+	}
+
+	if !changed {
+		return image.Rectangle{}, false
+	}
+	return image.Rect(minX, minY, maxX, maxY), true
+}
@@ -0,0 +1,171 @@
+package apng
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// TestOptimizePalettedRoundTrip reproduces the review's exact repro: a
+// paletted, multi-frame animation run through Optimize (which introduces
+// partial transparency into every frame but the first) must still encode
+// and decode successfully. This used to fail with
+// "png: invalid format: bad filter type" because frame 0 stayed paletted
+// while Optimize's cropped frames became RGBA, and each was given a
+// different PNG color type under one shared IHDR.
+func TestOptimizePalettedRoundTrip(t *testing.T) {
+	palette := color.Palette{
+		color.RGBA{R: 0, G: 0, B: 0, A: 255},
+		color.RGBA{R: 255, G: 0, B: 0, A: 255},
+		color.RGBA{R: 0, G: 255, B: 0, A: 255},
+	}
+
+	frame0 := image.NewPaletted(image.Rect(0, 0, 4, 4), palette)
+	frame1 := image.NewPaletted(image.Rect(0, 0, 4, 4), palette)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			frame0.SetColorIndex(x, y, 1)
+			frame1.SetColorIndex(x, y, 1)
+		}
+	}
+	// Change a small region in frame1 so Optimize has something to crop.
+	frame1.SetColorIndex(1, 1, 2)
+	frame1.SetColorIndex(2, 1, 2)
+
+	a := &APNG{
+		Images: []image.Image{frame0, frame1},
+		Delays: []uint16{10, 10},
+	}
+
+	if err := Optimize(a); err != nil {
+		t.Fatalf("Optimize: %v", err)
+	}
+	if a.BlendOps[1] != BlendOpOver {
+		t.Fatalf("got BlendOps[1] %d, want BlendOpOver", a.BlendOps[1])
+	}
+	if a.Disposals[1] != DisposeOpNone {
+		t.Fatalf("got Disposals[1] %d, want DisposeOpNone", a.Disposals[1])
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeAll(&buf, a); err != nil {
+		t.Fatalf("EncodeAll: %v", err)
+	}
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(got.Images) != 2 {
+		t.Fatalf("got %d frames, want 2", len(got.Images))
+	}
+}
+
+// renderCanvas replays a decoded APNG's frames onto a single running canvas
+// using its BlendOps, mirroring what a real decoder would show on screen.
+func renderCanvas(a *APNG) *image.RGBA {
+	bounds := a.Images[0].Bounds()
+	canvas := image.NewRGBA(bounds)
+	for i, img := range a.Images {
+		op := draw.Over
+		if a.BlendOps[i] == BlendOpSource {
+			op = draw.Src
+		}
+		draw.Draw(canvas, img.Bounds(), img, img.Bounds().Min, op)
+	}
+	return canvas
+}
+
+// TestOptimizeAlphaReducingEdit reproduces the review's repro: a frame fades
+// a pixel to fully transparent relative to the previous canvas. Optimize must
+// not lose that edit, whether by mis-simulating the un-optimized canvas with
+// draw.Over (collapsing the diff rect) or by writing the faded pixel as the
+// same color.RGBA{} sentinel used for "leave this pixel alone" under
+// BlendOpOver (making the edit invisible again at render time).
+func TestOptimizeAlphaReducingEdit(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+
+	frame0 := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(frame0, frame0.Bounds(), &image.Uniform{C: red}, image.Point{}, draw.Src)
+
+	frame1 := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(frame1, frame1.Bounds(), &image.Uniform{C: red}, image.Point{}, draw.Src)
+	frame1.SetRGBA(1, 1, color.RGBA{}) // Fade this pixel to fully transparent.
+
+	a := &APNG{
+		Images: []image.Image{frame0, frame1},
+		Delays: []uint16{10, 10},
+	}
+
+	if err := Optimize(a); err != nil {
+		t.Fatalf("Optimize: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeAll(&buf, a); err != nil {
+		t.Fatalf("EncodeAll: %v", err)
+	}
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	canvas := renderCanvas(got)
+	if _, _, _, a := canvas.RGBAAt(1, 1).RGBA(); a != 0 {
+		t.Fatalf("pixel (1,1) alpha = %d, want 0 (faded to transparent)", a)
+	}
+	// A pixel away from the fade: unchanged other than the imperceptible
+	// one-unit alpha nudge unifyFrameFormat applies to keep frame0's PNG
+	// color type consistent with frame1's now-partial transparency.
+	if c := canvas.RGBAAt(3, 3); c.R != red.R || c.G != red.G || c.B != red.B || c.A < red.A-1 {
+		t.Fatalf("pixel (3,3) = %v, want ~%v", c, red)
+	}
+}
+
+// TestOptimizePartialAlphaReducingEdit covers a pixel that fades to
+// semi-transparent, not all the way to zero. Porter-Duff Over can never
+// reduce alpha against a non-transparent canvas pixel (composited alpha is
+// always >= the destination's), so this needs the same BlendOpSource
+// fallback as a fade to fully transparent, not just the color.RGBA{}
+// sentinel-collision case.
+func TestOptimizePartialAlphaReducingEdit(t *testing.T) {
+	opaqueRed := color.RGBA{R: 255, A: 255}
+	fadedRed := color.RGBA{R: 128, A: 128} // Premultiplied: half-alpha red.
+
+	frame0 := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(frame0, frame0.Bounds(), &image.Uniform{C: opaqueRed}, image.Point{}, draw.Src)
+
+	frame1 := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(frame1, frame1.Bounds(), &image.Uniform{C: opaqueRed}, image.Point{}, draw.Src)
+	frame1.SetRGBA(1, 1, fadedRed)
+
+	a := &APNG{
+		Images: []image.Image{frame0, frame1},
+		Delays: []uint16{10, 10},
+	}
+
+	if err := Optimize(a); err != nil {
+		t.Fatalf("Optimize: %v", err)
+	}
+	if a.BlendOps[1] != BlendOpSource {
+		t.Fatalf("got BlendOps[1] %d, want BlendOpSource", a.BlendOps[1])
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeAll(&buf, a); err != nil {
+		t.Fatalf("EncodeAll: %v", err)
+	}
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	canvas := renderCanvas(got)
+	if c := canvas.RGBAAt(1, 1); c != fadedRed {
+		t.Fatalf("pixel (1,1) = %v, want %v", c, fadedRed)
+	}
+}
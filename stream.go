@@ -0,0 +1,281 @@
+package apng
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+)
+
+// StreamConfig configures a StreamEncoder.
+type StreamConfig struct {
+	// NumFrames is the total number of frames that will be written. It is
+	// required unless w (passed to NewStreamEncoder) is an io.WriteSeeker,
+	// in which case the acTL chunk's frame count is patched in on Close.
+	NumFrames int
+
+	LoopCount        uint32           // The loop count. 0 indicates infinite looping.
+	CompressionLevel png.CompressionLevel
+	BufferPool       png.EncoderBufferPool
+}
+
+// StreamEncoder writes an APNG one frame at a time, so a caller doesn't need
+// to hold every frame in memory at once. Create one with NewStreamEncoder,
+// call WriteFrame for each frame in order, then Close.
+type StreamEncoder struct {
+	enc    encoder
+	cfg    StreamConfig
+	pngEnc *png.Encoder
+	ws     io.WriteSeeker // non-nil if the writer passed to NewStreamEncoder supports seeking
+
+	acTLDataPos int64 // offset of the acTL chunk's data, for patching on Close
+	frameCount  int
+	closed      bool
+
+	origin   image.Point // first frame's Bounds().Min, the shared coordinate space's (0,0)
+	canvasSz image.Point // first frame's Bounds().Dx()/Dy(), the full canvas size
+}
+
+// NewStreamEncoder writes the PNG signature to w and returns a StreamEncoder
+// ready to accept frames via WriteFrame.
+func NewStreamEncoder(w io.Writer, cfg StreamConfig) (*StreamEncoder, error) {
+	ws, seekable := w.(io.WriteSeeker)
+	if cfg.NumFrames <= 0 && !seekable {
+		return nil, errors.New("apng: StreamConfig.NumFrames must be set when w is not an io.WriteSeeker")
+	}
+
+	se := &StreamEncoder{
+		enc: encoder{writer: w},
+		cfg: cfg,
+		pngEnc: &png.Encoder{
+			CompressionLevel: cfg.CompressionLevel,
+			BufferPool:       cfg.BufferPool,
+		},
+		ws: ws,
+	}
+
+	if _, err := io.WriteString(w, pngHeader); err != nil {
+		return nil, err
+	}
+	return se, nil
+}
+
+// encodeImage runs img through se.pngEnc, using bufferPool the same way
+// Encoder.Encode does.
+//
+// Unlike Encoder.Encode, a stream can't look ahead to see whether a later
+// frame will need an alpha channel, so every opaque non-paletted frame is
+// nudged unconditionally (rather than only once a translucent frame is
+// known to exist), trading away image/png's opaque-frame optimization for
+// the guarantee that every frame gets the same PNG color type under the
+// stream's one shared IHDR. Frames that already have real transparency are
+// left untouched, same as unifyFrameFormat.
+func (se *StreamEncoder) encodeImage(img image.Image) (*pngChunk, *bytes.Buffer, error) {
+	if paletted, ok := img.(*image.Paletted); ok {
+		return encodePalettedImage(se.pngEnc, paletted)
+	}
+
+	nrgba := toNRGBA(img)
+	if nrgba.Opaque() {
+		nudgeAlpha(nrgba)
+	}
+
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if err := se.pngEnc.Encode(buf, nrgba); err != nil {
+		bufferPool.Put(buf)
+		return nil, nil, errors.New("apng: png encoding error(" + err.Error() + ")")
+	}
+	pc, err := fetchPNGChunk(buf)
+	if err != nil {
+		bufferPool.Put(buf)
+		return nil, nil, err
+	}
+	return pc, buf, nil
+}
+
+// writeACTL writes the acTL chunk. If cfg.NumFrames wasn't given up front, it
+// writes a placeholder num_frames of 0 and records where it needs patching.
+func (se *StreamEncoder) writeACTL() {
+	if se.enc.err != nil {
+		return
+	}
+
+	numFrames := uint32(se.cfg.NumFrames)
+	if se.cfg.NumFrames <= 0 {
+		pos, err := se.ws.Seek(0, io.SeekCurrent)
+		if err != nil {
+			se.enc.err = err
+			return
+		}
+		se.acTLDataPos = pos + 8 // past the 4-byte length and 4-byte "acTL" type.
+	}
+
+	var b [8]byte
+	writeUint32(b[0:4], numFrames)
+	writeUint32(b[4:8], se.cfg.LoopCount)
+	se.enc.writeChunk(b[:], "acTL")
+}
+
+func (se *StreamEncoder) writeFCTL(bounds image.Rectangle, offset image.Point, delay uint16, disposeOp, blendOp byte) {
+	var b [26]byte
+	writeUint32(b[0:4], se.enc.seqNum)
+	writeUint32(b[4:8], uint32(bounds.Dx()))
+	writeUint32(b[8:12], uint32(bounds.Dy()))
+	writeUint32(b[12:16], uint32(offset.X))
+	writeUint32(b[16:20], uint32(offset.Y))
+	writeUint16(b[20:22], delay)
+	writeUint16(b[22:24], uint16(100))
+	b[24] = disposeOp
+	b[25] = blendOp
+	se.enc.writeChunk(b[:], "fcTL")
+	se.enc.seqNum++
+}
+
+// frameOffset translates bounds into the stream's shared coordinate space,
+// anchored at the first frame's origin, mirroring frameLayout's batch-mode
+// behavior: the first frame always sits at (0,0) and covers the full canvas,
+// and every later frame must fit within it.
+func (se *StreamEncoder) frameOffset(bounds image.Rectangle) (image.Point, error) {
+	if se.frameCount == 0 {
+		se.origin = bounds.Min
+		se.canvasSz = image.Pt(bounds.Dx(), bounds.Dy())
+		return image.Point{}, nil
+	}
+	offset := image.Pt(bounds.Min.X-se.origin.X, bounds.Min.Y-se.origin.Y)
+	if offset.X < 0 || offset.Y < 0 || offset.X+bounds.Dx() > se.canvasSz.X || offset.Y+bounds.Dy() > se.canvasSz.Y {
+		return image.Point{}, errors.New("apng: must fullfill frame region constraints")
+	}
+	return offset, nil
+}
+
+func (se *StreamEncoder) writeFDATs(idats []idat) {
+	for _, id := range idats {
+		var seq [4]byte
+		writeUint32(seq[:], se.enc.seqNum)
+		fdat := make([]byte, 4, len(id)+4)
+		copy(fdat, seq[:])
+		fdat = append(fdat, id...)
+		se.enc.writeChunk(fdat, "fdAT")
+		se.enc.seqNum++
+	}
+}
+
+// WriteFrame encodes img and appends it as the next frame: the first call
+// also writes IHDR, PLTE/tRNS and acTL; every call writes an fcTL followed by
+// IDAT (for the first frame) or fdAT (for later frames).
+func (se *StreamEncoder) WriteFrame(img image.Image, delay uint16, disposeOp, blendOp byte) error {
+	if se.closed {
+		return errors.New("apng: WriteFrame called after Close")
+	}
+	if se.enc.err != nil {
+		return se.enc.err
+	}
+	if se.cfg.NumFrames > 0 && se.frameCount >= se.cfg.NumFrames {
+		return errors.New("apng: WriteFrame called more than StreamConfig.NumFrames times")
+	}
+
+	bounds := img.Bounds()
+	offset, err := se.frameOffset(bounds)
+	if err != nil {
+		se.enc.err = err
+		return err
+	}
+
+	// Normalize to a zero origin so frames obtained via img.SubImage()
+	// encode as a plain w x h image; their original position is already
+	// captured in offset.
+	pc, buf, err := se.encodeImage(offsetImage(img, 0, 0))
+	if err != nil {
+		se.enc.err = err
+		return err
+	}
+	defer bufferPool.Put(buf)
+
+	if se.frameCount == 0 {
+		se.enc.writeChunk(pc.ihdr, "IHDR")
+		if pc.plte != nil {
+			se.enc.writeChunk(pc.plte, "PLTE")
+		}
+		if pc.trns != nil {
+			se.enc.writeChunk(pc.trns, "tRNS")
+		}
+		se.writeACTL()
+	}
+
+	se.writeFCTL(bounds, offset, delay, disposeOp, blendOp)
+	if se.frameCount == 0 {
+		for _, id := range pc.idats {
+			se.enc.writeChunk(id, "IDAT")
+		}
+	} else {
+		se.writeFDATs(pc.idats)
+	}
+
+	se.frameCount++
+	return se.enc.err
+}
+
+// patchNumFrames seeks back to the acTL chunk written by writeACTL and fills
+// in the real frame count (and its CRC), then returns to the end of the
+// stream.
+func (se *StreamEncoder) patchNumFrames() error {
+	cur, err := se.ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := se.ws.Seek(se.acTLDataPos, io.SeekStart); err != nil {
+		return err
+	}
+
+	var data [8]byte
+	writeUint32(data[0:4], uint32(se.frameCount))
+	writeUint32(data[4:8], se.cfg.LoopCount)
+	if _, err := se.ws.Write(data[:]); err != nil {
+		return err
+	}
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte("acTL"))
+	crc.Write(data[:])
+	var crcBuf [4]byte
+	writeUint32(crcBuf[:], crc.Sum32())
+	if _, err := se.ws.Write(crcBuf[:]); err != nil {
+		return err
+	}
+
+	_, err = se.ws.Seek(cur, io.SeekStart)
+	return err
+}
+
+// Close writes the IEND chunk, patches the acTL frame count if it wasn't
+// known up front, and reports any write or validation error encountered
+// along the way.
+func (se *StreamEncoder) Close() error {
+	if se.closed {
+		return se.enc.err
+	}
+	se.closed = true
+
+	if se.enc.err != nil {
+		return se.enc.err
+	}
+	if se.frameCount == 0 {
+		return errors.New("apng: need at least one frame")
+	}
+	if se.cfg.NumFrames > 0 && se.frameCount != se.cfg.NumFrames {
+		return errors.New("apng: wrote fewer frames than StreamConfig.NumFrames")
+	}
+
+	se.enc.writeChunk(nil, "IEND")
+	if se.enc.err != nil {
+		return se.enc.err
+	}
+
+	if se.cfg.NumFrames <= 0 {
+		return se.patchNumFrames()
+	}
+	return nil
+}
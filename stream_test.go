@@ -0,0 +1,175 @@
+package apng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"testing"
+)
+
+func makeStreamFrame(r image.Rectangle, fill color.RGBA) *image.RGBA {
+	img := image.NewRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetRGBA(x, y, fill)
+		}
+	}
+	return img
+}
+
+// firstFCTLOffset scans raw APNG bytes for the first fcTL chunk and returns
+// its x_offset/y_offset fields.
+func firstFCTLOffset(t *testing.T, data []byte) image.Point {
+	t.Helper()
+	b := data[len(pngHeader):]
+	for len(b) >= 8 {
+		length := binary.BigEndian.Uint32(b[0:4])
+		name := string(b[4:8])
+		b = b[8:]
+		if uint32(len(b)) < length+4 {
+			t.Fatalf("truncated %s chunk", name)
+		}
+		chunkData := b[:length]
+		b = b[length+4:]
+		if name == "fcTL" {
+			x := binary.BigEndian.Uint32(chunkData[12:16])
+			y := binary.BigEndian.Uint32(chunkData[16:20])
+			return image.Pt(int(x), int(y))
+		}
+	}
+	t.Fatal("no fcTL chunk found")
+	return image.Point{}
+}
+
+// TestStreamFirstFrameSubImageOffset reproduces the review's repro: the
+// first frame passed to WriteFrame has a non-zero origin (a SubImage), and
+// its fcTL must still declare offset (0,0) covering the full canvas.
+func TestStreamFirstFrameSubImageOffset(t *testing.T) {
+	base := makeStreamFrame(image.Rect(0, 0, 8, 8), color.RGBA{R: 10, G: 20, B: 30, A: 255})
+	sub := base.SubImage(image.Rect(2, 2, 6, 6))
+
+	var buf bytes.Buffer
+	se, err := NewStreamEncoder(&buf, StreamConfig{NumFrames: 1})
+	if err != nil {
+		t.Fatalf("NewStreamEncoder: %v", err)
+	}
+	if err := se.WriteFrame(sub, 10, DisposeOpNone, BlendOpSource); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	if err := se.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	offset := firstFCTLOffset(t, buf.Bytes())
+	if offset != (image.Point{}) {
+		t.Fatalf("first frame fcTL offset = %v, want (0,0)", offset)
+	}
+}
+
+// TestStreamNonSeekableRoundTrip streams to a plain io.Writer (no Seek),
+// which requires StreamConfig.NumFrames to be set up front.
+func TestStreamNonSeekableRoundTrip(t *testing.T) {
+	frames := []*image.RGBA{
+		makeStreamFrame(image.Rect(0, 0, 4, 4), color.RGBA{R: 255, A: 255}),
+		makeStreamFrame(image.Rect(0, 0, 4, 4), color.RGBA{G: 255, A: 255}),
+	}
+
+	var buf bytes.Buffer
+	se, err := NewStreamEncoder(&buf, StreamConfig{NumFrames: len(frames)})
+	if err != nil {
+		t.Fatalf("NewStreamEncoder: %v", err)
+	}
+	for _, f := range frames {
+		if err := se.WriteFrame(f, 10, DisposeOpNone, BlendOpSource); err != nil {
+			t.Fatalf("WriteFrame: %v", err)
+		}
+	}
+	if err := se.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(got.Images) != len(frames) {
+		t.Fatalf("got %d frames, want %d", len(got.Images), len(frames))
+	}
+}
+
+// TestStreamMixedOpacityRoundTrip streams an opaque frame followed by a
+// translucent one: a stream can't look ahead to see the second frame needs
+// an alpha channel, so encodeImage must force every frame to carry one
+// unconditionally, or the opaque frame's IDAT would use a different PNG
+// color type than the shared IHDR declares.
+func TestStreamMixedOpacityRoundTrip(t *testing.T) {
+	opaque := makeStreamFrame(image.Rect(0, 0, 4, 4), color.RGBA{R: 255, A: 255})
+	translucent := makeStreamFrame(image.Rect(0, 0, 4, 4), color.RGBA{G: 200, A: 128})
+
+	var buf bytes.Buffer
+	se, err := NewStreamEncoder(&buf, StreamConfig{NumFrames: 2})
+	if err != nil {
+		t.Fatalf("NewStreamEncoder: %v", err)
+	}
+	if err := se.WriteFrame(opaque, 10, DisposeOpNone, BlendOpSource); err != nil {
+		t.Fatalf("WriteFrame(opaque): %v", err)
+	}
+	if err := se.WriteFrame(translucent, 10, DisposeOpNone, BlendOpSource); err != nil {
+		t.Fatalf("WriteFrame(translucent): %v", err)
+	}
+	if err := se.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(got.Images) != 2 {
+		t.Fatalf("got %d frames, want 2", len(got.Images))
+	}
+}
+
+// TestStreamSeekableRoundTrip streams to an io.WriteSeeker without setting
+// StreamConfig.NumFrames up front, relying on Close to seek back and patch
+// acTL's frame count.
+func TestStreamSeekableRoundTrip(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "apng-stream-*.png")
+	if err != nil {
+		t.Fatalf("CreateTemp: %v", err)
+	}
+	defer f.Close()
+
+	frames := []*image.RGBA{
+		makeStreamFrame(image.Rect(0, 0, 4, 4), color.RGBA{R: 255, A: 255}),
+		makeStreamFrame(image.Rect(0, 0, 4, 4), color.RGBA{G: 255, A: 255}),
+		makeStreamFrame(image.Rect(0, 0, 4, 4), color.RGBA{B: 255, A: 255}),
+	}
+
+	se, err := NewStreamEncoder(f, StreamConfig{})
+	if err != nil {
+		t.Fatalf("NewStreamEncoder: %v", err)
+	}
+	for _, fr := range frames {
+		if err := se.WriteFrame(fr, 10, DisposeOpNone, BlendOpSource); err != nil {
+			t.Fatalf("WriteFrame: %v", err)
+		}
+	}
+	if err := se.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	got, err := Decode(f)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(got.Images) != len(frames) {
+		t.Fatalf("got %d frames, want %d", len(got.Images), len(frames))
+	}
+}
@@ -0,0 +1,59 @@
+package apng
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestEncodeSubImageFrames covers frames sourced via image.SubImage: the
+// first frame's own origin defines the shared canvas, and later frames are
+// positioned relative to it.
+func TestEncodeSubImageFrames(t *testing.T) {
+	canvas := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			canvas.SetRGBA(x, y, color.RGBA{R: uint8(x * 10), G: uint8(y * 10), B: 0, A: 255})
+		}
+	}
+
+	frame0 := canvas.SubImage(image.Rect(0, 0, 8, 8))
+	frame1 := canvas.SubImage(image.Rect(2, 2, 6, 6))
+
+	a := &APNG{
+		Images: []image.Image{frame0, frame1},
+		Delays: []uint16{10, 10},
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeAll(&buf, a); err != nil {
+		t.Fatalf("EncodeAll: %v", err)
+	}
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(got.Images) != 2 {
+		t.Fatalf("got %d frames, want 2", len(got.Images))
+	}
+
+	b1 := got.Images[1].Bounds()
+	want := image.Rect(2, 2, 6, 6)
+	if b1 != want {
+		t.Fatalf("frame 1 bounds = %v, want %v", b1, want)
+	}
+
+	// Both frames are fully opaque, so unifyFrameFormat never needs to nudge
+	// alpha here: pixels should round-trip exactly.
+	for y := want.Min.Y; y < want.Max.Y; y++ {
+		for x := want.Min.X; x < want.Max.X; x++ {
+			wr, wg, wb, wa := canvas.At(x, y).RGBA()
+			gr, gg, gb, ga := got.Images[1].At(x, y).RGBA()
+			if wr != gr || wg != gg || wb != gb || wa != ga {
+				t.Fatalf("pixel (%d,%d): got %v want %v", x, y, got.Images[1].At(x, y), canvas.At(x, y))
+			}
+		}
+	}
+}
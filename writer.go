@@ -7,6 +7,7 @@ import (
 	"errors"
 	"hash/crc32"
 	"image"
+	"image/draw"
 	"image/png"
 	"io"
 	"strconv"
@@ -17,6 +18,19 @@ type idat []byte
 
 const pngHeader string = "\x89PNG\r\n\x1a\n"
 
+// APNG dispose_op values, as defined by the APNG spec.
+const (
+	DisposeOpNone       byte = 0 // Leave the frame's region as-is.
+	DisposeOpBackground byte = 1 // Clear the frame's region to transparent black.
+	DisposeOpPrevious   byte = 2 // Restore the frame's region to its prior contents.
+)
+
+// APNG blend_op values, as defined by the APNG spec.
+const (
+	BlendOpSource byte = 0 // Overwrite the canvas with the frame's pixels.
+	BlendOpOver   byte = 1 // Alpha-blend the frame's pixels onto the canvas.
+)
+
 const (
 	dsStart = iota
 	dsSeenIHDR
@@ -40,21 +54,54 @@ func writeUint32(b []uint8, u uint32) {
 
 // APNG encapsulates animated PNG frames, their delays, disposal methods, loop count, and global configuration.
 type APNG struct {
-	// The successive images.
-	//
-	// Images obtained via SubImage() are not supported, If an image is a sub-image, copy it into a new image before encoding.
+	// The successive images. Frames obtained via image.SubImage() are
+	// supported: each frame's position is taken relative to the first
+	// frame's origin, and every frame must fit within the first frame's
+	// dimensions.
 	Images []image.Image
 
 	// The successive delay times, one per frame, in 100ths of a second (centiseconds).
 	Delays    []uint16
 	Disposals []byte // The successive disposal methods, one per frame.
+	BlendOps  []byte // The successive blend methods, one per frame. May be nil, in which case BlendOpSource is used for every frame.
 	LoopCount uint32 // The loop count. 0 indicates infinite looping.
 	Config    image.Config
 }
+
+// Encoder configures APNG encoding, mirroring image/png's Encoder.
+type Encoder struct {
+	// CompressionLevel is forwarded to the underlying image/png encoder used
+	// for every frame.
+	CompressionLevel png.CompressionLevel
+
+	// BufferPool, if non-nil, lets per-frame png encodes reuse
+	// png.EncoderBuffers instead of allocating one per frame.
+	BufferPool png.EncoderBufferPool
+
+	// NumWorkers caps how many frames are encoded concurrently. A value <= 0
+	// means unbounded, i.e. one goroutine per frame.
+	NumWorkers int
+}
+
+func (enc *Encoder) pngEncoder() *png.Encoder {
+	return &png.Encoder{
+		CompressionLevel: enc.CompressionLevel,
+		BufferPool:       enc.BufferPool,
+	}
+}
+
+// bufferPool pools the *bytes.Buffer used to hold a frame's encoded PNG
+// chunks so encoding a many-frame animation doesn't churn hundreds of
+// megabytes of short-lived buffers.
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
 type encoder struct {
-	aPNG   *APNG
-	writer io.Writer
-	seqNum uint32 // Sequence number of the animation chunk.
+	aPNG    *APNG
+	writer  io.Writer
+	seqNum  uint32         // Sequence number of the animation chunk.
+	offsets []image.Point // Each frame's x_offset/y_offset, relative to the first frame's origin.
 
 	tmpHeader [8]byte
 	tmp       [4 * 256]byte
@@ -114,17 +161,21 @@ func (e *encoder) writeacTL() {
 func (e *encoder) writefcTL(frameIndex int) {
 	writeUint32(e.tmp[0:4], e.seqNum) // Write sequence_number.
 	bounds := (e.aPNG.Images[frameIndex]).Bounds()
+	offset := e.offsets[frameIndex]
 	writeUint32(e.tmp[4:8], uint32(bounds.Max.X-bounds.Min.X))  // Write width.
 	writeUint32(e.tmp[8:12], uint32(bounds.Max.Y-bounds.Min.Y)) // Write height.
-	writeUint32(e.tmp[12:16], uint32(bounds.Min.X))             // Write x_offset.
-	writeUint32(e.tmp[16:20], uint32(bounds.Min.Y))             // Write y_offset.
+	writeUint32(e.tmp[12:16], uint32(offset.X))                 // Write x_offset.
+	writeUint32(e.tmp[16:20], uint32(offset.Y))                 // Write y_offset.
 	writeUint16(e.tmp[20:22], e.aPNG.Delays[frameIndex])        // Write delay_num(numerator).
 	writeUint16(e.tmp[22:24], uint16(100))                      // Write delay_den(denominator).
-	e.tmp[24] = 0
+	e.tmp[24] = DisposeOpNone
 	if e.aPNG.Disposals != nil {
 		e.tmp[24] = e.aPNG.Disposals[frameIndex] // Write dispose_op
 	}
-	e.tmp[25] = 0 // Write blend_op.
+	e.tmp[25] = BlendOpSource
+	if e.aPNG.BlendOps != nil {
+		e.tmp[25] = e.aPNG.BlendOps[frameIndex] // Write blend_op.
+	}
 
 	e.writeChunk(e.tmp[:26], "fcTL")
 	e.seqNum++
@@ -160,6 +211,12 @@ type chunkFetcher struct {
 	trns  []byte // tRNS chunk data
 }
 
+// fetcherPool pools chunkFetchers (and their tmp scratch arrays) across the
+// many frames of an animation.
+var fetcherPool = sync.Pool{
+	New: func() any { return new(chunkFetcher) },
+}
+
 type pngChunk struct {
 	ihdr  []byte
 	idats []idat
@@ -290,11 +347,13 @@ func (c *chunkFetcher) parsePNGChunkWithPalette() error {
 
 func fetchPNGChunk(bb *bytes.Buffer) (*pngChunk, error) {
 	bb.Next(len(pngHeader))
-	c := &chunkFetcher{
-		bb:    bb,
-		stage: dsStart,
-		pc:    new(pngChunk),
-	}
+	c := fetcherPool.Get().(*chunkFetcher)
+	c.bb = bb
+	c.stage = dsStart
+	c.pc = new(pngChunk)
+	c.plte = nil
+	c.trns = nil
+	defer fetcherPool.Put(c)
 
 	for c.stage != dsSeenIEND {
 		if err := c.parsePNGChunk(); err != nil {
@@ -310,10 +369,13 @@ func fetchPNGChunk(bb *bytes.Buffer) (*pngChunk, error) {
 // fetchPaletteChunk extracts PLTE and tRNS chunks from paletted images
 func fetchPaletteChunk(bb *bytes.Buffer) (plte []byte, trns []byte, err error) {
 	bb.Next(len(pngHeader))
-	c := &chunkFetcher{
-		bb:    bb,
-		stage: dsStart,
-	}
+	c := fetcherPool.Get().(*chunkFetcher)
+	c.bb = bb
+	c.stage = dsStart
+	c.pc = nil
+	c.plte = nil
+	c.trns = nil
+	defer fetcherPool.Put(c)
 
 	for c.stage != dsSeenIEND {
 		if err := c.parsePNGChunkWithPalette(); err != nil {
@@ -326,39 +388,153 @@ func fetchPaletteChunk(bb *bytes.Buffer) (plte []byte, trns []byte, err error) {
 	return c.plte, c.trns, nil
 }
 
-// encodePalettedImage encodes a paletted image for APNG format
-func encodePalettedImage(img *image.Paletted) (*pngChunk, error) {
-	bb := &bytes.Buffer{}
-	if err := png.Encode(bb, img); err != nil {
-		return nil, errors.New("apng: palette encoding error: " + err.Error())
+// encodePalettedImage encodes a paletted image for APNG format using pngEnc.
+func encodePalettedImage(pngEnc *png.Encoder, img *image.Paletted) (*pngChunk, *bytes.Buffer, error) {
+	bb := bufferPool.Get().(*bytes.Buffer)
+	bb.Reset()
+	if err := pngEnc.Encode(bb, img); err != nil {
+		bufferPool.Put(bb)
+		return nil, nil, errors.New("apng: palette encoding error: " + err.Error())
 	}
 
-	return fetchPNGChunk(bb)
+	pc, err := fetchPNGChunk(bb)
+	if err != nil {
+		bufferPool.Put(bb)
+		return nil, nil, err
+	}
+	return pc, bb, nil
 }
 
-func fullfillFrameRegionConstraints(img []image.Image) bool {
-	if len(img) == 0 || img[0] == nil {
-		return false
+// frameLayout translates every frame's bounds into a shared coordinate space
+// anchored at the first frame's origin, so that frames obtained via
+// img.SubImage() (or any image.Image with a non-zero Bounds().Min) work the
+// same as frames already anchored at (0,0). It returns each frame's
+// x_offset/y_offset in that space, erroring if a frame doesn't fit within
+// the canvas defined by the first frame.
+func frameLayout(images []image.Image) ([]image.Point, error) {
+	if len(images) == 0 || images[0] == nil {
+		return nil, errors.New("apng: need at least one image")
+	}
+	canvas := images[0].Bounds()
+
+	offsets := make([]image.Point, len(images))
+	for i, img := range images {
+		if img == nil {
+			return nil, errors.New("apng: must fullfill frame region constraints")
+		}
+		bounds := img.Bounds()
+		offset := image.Pt(bounds.Min.X-canvas.Min.X, bounds.Min.Y-canvas.Min.Y)
+		if offset.X < 0 || offset.Y < 0 || offset.X+bounds.Dx() > canvas.Dx() || offset.Y+bounds.Dy() > canvas.Dy() {
+			return nil, errors.New("apng: must fullfill frame region constraints")
+		}
+		offsets[i] = offset
+	}
+	return offsets, nil
+}
+
+// unifyFrameFormat returns images encoded through image/png with one
+// consistent color type, so the single top-level IHDR (taken from frame 0)
+// correctly describes every frame's IDAT/fdAT payload. image/png picks a
+// color type per image independently (e.g. it drops the alpha channel for
+// an otherwise-RGBA image that happens to be fully opaque), which silently
+// produces a corrupt file once frames are encoded one at a time under a
+// shared IHDR.
+//
+// If every frame is *image.Paletted and shares the exact same palette, the
+// frames are returned unchanged: image/png already encodes all of them with
+// the same color type and bit depth. Otherwise every frame is converted to
+// *image.NRGBA, and if any of them needs an alpha channel, frames that would
+// otherwise encode as fully opaque are nudged by one unit of alpha on a
+// single pixel so image/png's opaque-image optimization doesn't drop their
+// alpha channel while other frames keep theirs.
+func unifyFrameFormat(images []image.Image) []image.Image {
+	if palettedSharedPalette(images) {
+		return images
+	}
+
+	frames := make([]*image.NRGBA, len(images))
+	needsAlpha := false
+	for i, img := range images {
+		frames[i] = toNRGBA(img)
+		if !frames[i].Opaque() {
+			needsAlpha = true
+		}
+	}
+	if needsAlpha {
+		for _, f := range frames {
+			if f.Opaque() {
+				nudgeAlpha(f)
+			}
+		}
 	}
-	reference := img[0].Bounds()
-	// constraints:
-	if !(reference.Min.X >= 0 && reference.Min.Y >= 0) {
+
+	out := make([]image.Image, len(frames))
+	for i, f := range frames {
+		out[i] = f
+	}
+	return out
+}
+
+// palettedSharedPalette reports whether every image is an *image.Paletted
+// using byte-for-byte the same palette.
+func palettedSharedPalette(images []image.Image) bool {
+	first, ok := images[0].(*image.Paletted)
+	if !ok {
 		return false
 	}
-	for i := 1; i < len(img); i++ {
-		if img[i] == nil {
+	for _, img := range images[1:] {
+		p, ok := img.(*image.Paletted)
+		if !ok || len(p.Palette) != len(first.Palette) {
 			return false
 		}
-		bounds := img[i].Bounds()
-		if !(bounds.Min.X >= 0 && bounds.Min.Y >= 0 && bounds.Max.X <= reference.Max.X && bounds.Max.Y <= reference.Max.Y) {
-			return false
+		for i, c := range first.Palette {
+			if p.Palette[i] != c {
+				return false
+			}
 		}
 	}
 	return true
 }
 
-// EncodeAll encodes the entire APNG struct to the io.Writer, validating input constraints.
-func EncodeAll(w io.Writer, a *APNG) error {
+// toNRGBA copies img into a fresh, zero-origin *image.NRGBA.
+func toNRGBA(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+// nudgeAlpha lowers a single pixel's alpha by one unit (imperceptible) so
+// img.Opaque() reports false, keeping its PNG color type consistent with
+// frames that do have transparency.
+func nudgeAlpha(img *image.NRGBA) {
+	b := img.Bounds()
+	if b.Empty() {
+		return
+	}
+	c := img.NRGBAAt(b.Min.X, b.Min.Y)
+	if c.A == 0 {
+		c.A = 1
+	} else {
+		c.A--
+	}
+	img.SetNRGBA(b.Min.X, b.Min.Y, c)
+}
+
+// frameData holds a frame's encoded PNG chunks plus the buffer they were
+// encoded into, so the buffer can be returned to bufferPool once the frame
+// has been written out.
+type frameData struct {
+	index      int
+	ihdr       []byte
+	idats      []idat
+	isPaletted bool
+	buf        *bytes.Buffer
+}
+
+// Encode encodes the entire APNG struct to w, validating input constraints
+// and using enc's CompressionLevel, BufferPool and NumWorkers.
+func (enc *Encoder) Encode(w io.Writer, a *APNG) error {
 	if len(a.Images) == 0 {
 		return errors.New("apng: need at least one image")
 	}
@@ -368,66 +544,92 @@ func EncodeAll(w io.Writer, a *APNG) error {
 	if a.Disposals != nil && len(a.Images) != len(a.Disposals) {
 		return errors.New("apng: mismatch image and disposal lengths")
 	}
-	if !fullfillFrameRegionConstraints(a.Images) {
-		return errors.New("apng: must fullfill frame region constraints")
+	if a.BlendOps != nil && len(a.Images) != len(a.BlendOps) {
+		return errors.New("apng: mismatch image and blend op lengths")
+	}
+	offsets, err := frameLayout(a.Images)
+	if err != nil {
+		return err
 	}
+	frames := unifyFrameFormat(a.Images)
 
 	e := encoder{
-		aPNG:   a,
-		writer: w,
+		aPNG:    a,
+		writer:  w,
+		offsets: offsets,
 	}
 
 	_, e.err = io.WriteString(w, pngHeader)
 
+	pngEnc := enc.pngEncoder()
+
 	// Data to be used while processing the first image
 	var mutex sync.Mutex
 	var hasFirstPaletted bool
 	var globalPLTE, globalTRNS []byte
 
-	// Check if the first image is paletted
-	if firstImg, ok := a.Images[0].(*image.Paletted); ok {
+	// Check if the first image is paletted. This is checked against frames
+	// (the unified, to-be-encoded images), not a.Images, since
+	// unifyFrameFormat may have converted a paletted frame 0 to NRGBA to keep
+	// it consistent with the rest of the animation.
+	if firstImg, ok := frames[0].(*image.Paletted); ok {
 		hasFirstPaletted = true
 
 		// Extract PLTE and tRNS chunks from the first paletted image
-		bb := &bytes.Buffer{}
-		if err := png.Encode(bb, firstImg); err != nil {
+		bb := bufferPool.Get().(*bytes.Buffer)
+		bb.Reset()
+		if err := pngEnc.Encode(bb, firstImg); err != nil {
+			bufferPool.Put(bb)
 			return errors.New("apng: png encoding error(" + err.Error() + ")")
 		}
 
 		var err error
 		globalPLTE, globalTRNS, err = fetchPaletteChunk(bb)
+		bufferPool.Put(bb)
 		if err != nil {
 			return err
 		}
 	}
 
-	// Prepare PNG data for all frames in parallel
-	type frameData struct {
-		index      int
-		ihdr       []byte
-		idats      []idat
-		isPaletted bool
-	}
-
+	// Prepare PNG data for all frames, fanned out across at most
+	// enc.NumWorkers goroutines (unbounded if <= 0).
 	frameDataChan := make(chan frameData, len(a.Images))
 	var wg sync.WaitGroup
 
-	for i, img := range a.Images {
+	var sem chan struct{}
+	if enc.NumWorkers > 0 {
+		sem = make(chan struct{}, enc.NumWorkers)
+	}
+
+	for i, img := range frames {
 		wg.Add(1)
 		go func(index int, img image.Image) {
 			defer wg.Done()
 
+			if sem != nil {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+			}
+
+			// Normalize to a zero origin so frames obtained via
+			// img.SubImage() encode as a plain w x h image; their original
+			// position is already captured in e.offsets.
+			img = offsetImage(img, 0, 0)
+
 			// Check for paletted image
 			paletted, isPaletted := img.(*image.Paletted)
 
 			var pc *pngChunk
+			var buf *bytes.Buffer
 			var err error
 
 			if isPaletted {
-				pc, err = encodePalettedImage(paletted)
+				pc, buf, err = encodePalettedImage(pngEnc, paletted)
 			} else {
-				bb := &bytes.Buffer{}
-				if err := png.Encode(bb, img); err != nil {
+				buf = bufferPool.Get().(*bytes.Buffer)
+				buf.Reset()
+				if err := pngEnc.Encode(buf, img); err != nil {
+					bufferPool.Put(buf)
 					mutex.Lock()
 					if e.err == nil {
 						e.err = errors.New("apng: png encoding error(" + err.Error() + ")")
@@ -435,7 +637,10 @@ func EncodeAll(w io.Writer, a *APNG) error {
 					mutex.Unlock()
 					return
 				}
-				pc, err = fetchPNGChunk(bb)
+				pc, err = fetchPNGChunk(buf)
+				if err != nil {
+					bufferPool.Put(buf)
+				}
 			}
 
 			if err != nil {
@@ -452,6 +657,7 @@ func EncodeAll(w io.Writer, a *APNG) error {
 				ihdr:       pc.ihdr,
 				idats:      pc.idats,
 				isPaletted: isPaletted,
+				buf:        buf,
 			}
 		}(i, img)
 	}
@@ -497,6 +703,7 @@ func EncodeAll(w io.Writer, a *APNG) error {
 	e.writeacTL()
 	e.writefcTL(0)
 	e.writeIDATs()
+	bufferPool.Put(fd.buf)
 
 	// Process other frames
 	for i := 1; i < len(a.Images); i++ {
@@ -510,9 +717,16 @@ func EncodeAll(w io.Writer, a *APNG) error {
 
 		e.writefcTL(i)
 		e.writefdATs()
+		bufferPool.Put(fd.buf)
 	}
 
 	e.writeIEND()
 
 	return e.err
 }
+
+// EncodeAll encodes the entire APNG struct to the io.Writer, validating
+// input constraints, using default compression and unbounded parallelism.
+func EncodeAll(w io.Writer, a *APNG) error {
+	return new(Encoder).Encode(w, a)
+}
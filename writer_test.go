@@ -0,0 +1,73 @@
+package apng
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"sync"
+	"testing"
+)
+
+// encoderBufferPool adapts a sync.Pool to png.EncoderBufferPool, the pattern
+// documented by image/png for reusing png.EncoderBuffers across frames.
+type encoderBufferPool sync.Pool
+
+func (p *encoderBufferPool) Get() *png.EncoderBuffer {
+	buf, _ := (*sync.Pool)(p).Get().(*png.EncoderBuffer)
+	return buf
+}
+
+func (p *encoderBufferPool) Put(buf *png.EncoderBuffer) {
+	(*sync.Pool)(p).Put(buf)
+}
+
+// TestEncoderConcurrentWorkers checks that a configured Encoder (bounded
+// worker count, explicit compression level, pooled EncoderBuffers) produces
+// an animation that decodes back with the right frame count and ordering,
+// since Encode fans frame encoding out across goroutines and reassembles
+// them by index.
+func TestEncoderConcurrentWorkers(t *testing.T) {
+	const n = 6
+	images := make([]image.Image, n)
+	delays := make([]uint16, n)
+	for i := range images {
+		img := image.NewRGBA(image.Rect(0, 0, 3, 3))
+		for y := 0; y < 3; y++ {
+			for x := 0; x < 3; x++ {
+				img.SetRGBA(x, y, color.RGBA{R: uint8(i * 30), G: uint8(x * 10), B: uint8(y * 10), A: 255})
+			}
+		}
+		images[i] = img
+		delays[i] = uint16(5 + i)
+	}
+
+	a := &APNG{Images: images, Delays: delays, LoopCount: 3}
+
+	enc := &Encoder{
+		CompressionLevel: png.BestSpeed,
+		BufferPool:       (*encoderBufferPool)(new(sync.Pool)),
+		NumWorkers:       2,
+	}
+
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, a); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(got.Images) != n {
+		t.Fatalf("got %d frames, want %d", len(got.Images), n)
+	}
+	for i := range delays {
+		if got.Delays[i] != delays[i] {
+			t.Fatalf("frame %d: got delay %d, want %d", i, got.Delays[i], delays[i])
+		}
+	}
+	if got.LoopCount != 3 {
+		t.Fatalf("got LoopCount %d, want 3", got.LoopCount)
+	}
+}